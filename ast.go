@@ -0,0 +1,30 @@
+package particle
+
+import "go/ast"
+
+// StructDecl pairs a struct's *ast.TypeSpec with its *ast.StructType, saving
+// callers the type assertion.
+type StructDecl struct {
+	Spec *ast.TypeSpec
+	Type *ast.StructType
+}
+
+// Structs returns every struct type declared in pkg, in the order they are
+// encountered while walking its files. SchemaGenerator back-ends use it to
+// walk the same declarations the Go generator does.
+func Structs(pkg *ast.Package) []StructDecl {
+	var decls []StructDecl
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				decls = append(decls, StructDecl{Spec: spec, Type: st})
+			}
+			return true
+		})
+	}
+	return decls
+}
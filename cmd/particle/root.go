@@ -3,12 +3,14 @@ package main
 import (
 	"errors"
 	"fmt"
-	"github.com/bmatcuk/doublestar/v4"
 	"github.com/lukasl-dev/particle"
+	_ "github.com/lukasl-dev/particle/plugins/jsonmarshal"
+	"github.com/lukasl-dev/particle/schema/cue"
+	"github.com/lukasl-dev/particle/schema/jsonschema"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
-	"go/parser"
-	"go/token"
+	"golang.org/x/tools/go/packages"
+	"go/ast"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,8 +21,8 @@ type rootCmd struct {
 	// run mode.
 	dryRun bool
 
-	// globs is a slice of ("doublestar") glob patterns to match files against.
-	globs []string
+	// patterns is a slice of go/packages patterns to load, e.g. "./...".
+	patterns []string
 
 	// dir is the working directory to use. Defaults to ".".
 	dir string
@@ -37,6 +39,21 @@ type rootCmd struct {
 
 	// pkg is the name of the package to generate the code in.
 	pkg string
+
+	// plugins is the list of registered plugin names to run during
+	// generation.
+	plugins []string
+
+	// configPath is the path to a particle.yaml config file to load. An
+	// empty value falls back to particle.DefaultConfigPath in dir, if
+	// present.
+	configPath string
+
+	// types holds the per-type overrides loaded from the config file.
+	types map[string]particle.TypeConfig
+
+	// emit is the list of output formats to generate, e.g. "go,cue".
+	emit []string
 }
 
 // root creates the root cobra.Command and returns it.
@@ -53,11 +70,11 @@ func (c *rootCmd) bind(fs *pflag.FlagSet) {
 		"Whether to run the command in dry run mode.",
 	)
 	fs.StringSliceVarP(
-		&c.globs,
-		"glob",
-		"g",
-		nil,
-		"The glob patterns to match files against.",
+		&c.patterns,
+		"pattern",
+		"p",
+		[]string{"./..."},
+		"The go/packages patterns to load, e.g. \"./...\".",
 	)
 	fs.StringVarP(
 		&c.dir,
@@ -91,25 +108,88 @@ func (c *rootCmd) bind(fs *pflag.FlagSet) {
 		"partial",
 		"The name of the package to generate the code in.",
 	)
+	fs.StringSliceVar(
+		&c.plugins,
+		"plugin",
+		nil,
+		"The registered plugins to run during generation, e.g. \"json\".",
+	)
+	fs.StringVar(
+		&c.configPath,
+		"config",
+		"",
+		"Path to a particle.yaml config file. Defaults to \"particle.yaml\" in the working directory if present.",
+	)
+	fs.StringSliceVar(
+		&c.emit,
+		"emit",
+		[]string{"go"},
+		"The output formats to generate, e.g. \"go,cue,jsonschema\".",
+	)
 }
 
 // build builds the root cobra.Command and returns it.
 func (c *rootCmd) build() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "particle",
-		Short:   "A generator for partial struct",
-		PreRunE: c.pre,
-		RunE:    c.run,
+		Use:   "particle",
+		Short: "A generator for partial struct",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.mergeConfig(cmd); err != nil {
+				return err
+			}
+			return c.pre(cmd, args)
+		},
+		RunE: c.run,
 	}
 	c.bind(cmd.Flags())
 	return cmd
 }
 
+// mergeConfig loads the particle.yaml config file, if any, and applies its
+// values to every flag the user did not explicitly set.
+func (c *rootCmd) mergeConfig(cmd *cobra.Command) error {
+	path := c.configPath
+	if path == "" {
+		path = filepath.Join(c.dir, particle.DefaultConfigPath)
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	cfg, err := particle.LoadConfig(path)
+	if err != nil {
+		return fmt.Errorf("could not load config: %w", err)
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("pattern") && len(cfg.Patterns) > 0 {
+		c.patterns = cfg.Patterns
+	}
+	if !flags.Changed("out") && cfg.Out != "" {
+		c.out = cfg.Out
+	}
+	if !flags.Changed("package") && cfg.Package != "" {
+		c.pkg = cfg.Package
+	}
+	if !flags.Changed("struct-tag") && cfg.StructTag != "" {
+		c.structTag = cfg.StructTag
+	}
+	if !flags.Changed("type-prefix") && cfg.TypePrefix != "" {
+		c.typePrefix = cfg.TypePrefix
+	}
+	if !flags.Changed("plugin") && len(cfg.Plugins) > 0 {
+		c.plugins = cfg.Plugins
+	}
+	c.types = cfg.Types
+
+	return nil
+}
+
 // pre validates c's flags.
 func (c *rootCmd) pre(*cobra.Command, []string) error {
 	switch {
-	case len(c.globs) == 0:
-		return errors.New("no glob patterns given: use --glob <pattern> to specify glob patterns")
+	case len(c.patterns) == 0:
+		return errors.New("no patterns given: use --pattern <pattern> to specify go/packages patterns")
 	case !c.dryRun && c.out == "":
 		return errors.New("no output file or directory given: use --out <path> to specify an output file or directory")
 	default:
@@ -119,58 +199,130 @@ func (c *rootCmd) pre(*cobra.Command, []string) error {
 
 // run runs the command.
 func (c *rootCmd) run(*cobra.Command, []string) error {
-	paths, err := c.glob()
+	pkgs, err := c.load()
 	if err != nil {
-		return fmt.Errorf("could not glob: %w", err)
+		return fmt.Errorf("could not load packages: %w", err)
 	}
 
-	for i, srcPath := range paths {
-		code, err := c.generate(srcPath)
-		if err != nil {
-			return fmt.Errorf("could not generate code: %w", err)
-		}
-
-		if c.dryRun {
-			fmt.Println("// Source:", srcPath)
-			fmt.Println(code)
-			if i != len(paths)-1 {
-				fmt.Println("---")
-			}
-			continue
-		}
-
-		if err := c.writeInto(srcPath, code); err != nil {
-			return fmt.Errorf("could not write: %w", err)
+	for _, pkg := range pkgs {
+		if err := c.generatePackage(pkg); err != nil {
+			return fmt.Errorf("could not generate code for %s: %w", pkg.PkgPath, err)
 		}
 	}
 
 	return nil
 }
 
-// glob returns the paths that match the globs.
-func (c *rootCmd) glob() ([]string, error) {
-	return doublestar.Glob(
-		os.DirFS(c.dir),
-		fmt.Sprintf("{%s}", strings.Join(c.globs, ",")),
-	)
-}
+// load loads the packages matching c.patterns, fully type-checked.
+func (c *rootCmd) load() ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Dir: c.dir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+			packages.NeedImports | packages.NeedTypes | packages.NeedSyntax |
+			packages.NeedTypesInfo,
+	}
 
-// generate generates the code for the given file path.
-func (c *rootCmd) generate(path string) (string, error) {
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	pkgs, err := packages.Load(cfg, c.patterns...)
 	if err != nil {
-		return "", fmt.Errorf("could not parse file: %w", err)
+		return nil, err
 	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return nil, errors.New("one or more packages contained errors")
+	}
+
+	return pkgs, nil
+}
 
+// generatePackage generates the code and side-car schema files for every
+// syntax file in pkg.
+func (c *rootCmd) generatePackage(pkg *packages.Package) error {
 	opts := particle.GeneratorOpts{
 		Package:    c.pkg,
 		StructTag:  c.structTag,
 		TypePrefix: c.typePrefix,
+		Plugins:    c.plugins,
+		Types:      c.types,
+	}
+
+	backends, err := c.schemaBackends(opts)
+	if err != nil {
+		return err
+	}
+	sg := particle.NewSchemaGenerator(opts, backends...)
+
+	for i, file := range pkg.Syntax {
+		srcPath := pkg.CompiledGoFiles[i]
+
+		if c.emits("go") {
+			g, err := particle.NewGenerator(opts, pkg)
+			if err != nil {
+				return fmt.Errorf("could not create generator: %w", err)
+			}
+			g.File(file)
+			code := g.Generate()
+
+			if c.dryRun {
+				fmt.Println("// Source:", srcPath)
+				fmt.Println(code)
+			} else if err := c.writeInto(srcPath, code); err != nil {
+				return fmt.Errorf("could not write: %w", err)
+			}
+		}
+
+		if len(backends) == 0 {
+			continue
+		}
+
+		astPkg := &ast.Package{
+			Name:  pkg.Name,
+			Files: map[string]*ast.File{srcPath: file},
+		}
+		baseName := strings.TrimSuffix(filepath.Base(srcPath), ".go")
+
+		sidecars, err := sg.Emit(astPkg, pkg.TypesInfo, baseName)
+		if err != nil {
+			return fmt.Errorf("could not emit schema for %s: %w", srcPath, err)
+		}
+		for name, data := range sidecars {
+			if c.dryRun {
+				fmt.Printf("// Source: %s (%s)\n%s\n", srcPath, name, data)
+				continue
+			}
+			if err := c.writeSidecar(name, data); err != nil {
+				return fmt.Errorf("could not write %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// emits reports whether format was requested via --emit.
+func (c *rootCmd) emits(format string) bool {
+	for _, e := range c.emit {
+		if e == format {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaBackends resolves the schema back-ends requested via --emit.
+func (c *rootCmd) schemaBackends(opts particle.GeneratorOpts) ([]particle.SchemaBackend, error) {
+	var backends []particle.SchemaBackend
+	for _, e := range c.emit {
+		switch e {
+		case "go":
+			continue
+		case "cue":
+			backends = append(backends, cue.New(opts))
+		case "jsonschema":
+			backends = append(backends, jsonschema.New(opts))
+		default:
+			return nil, fmt.Errorf("unknown emit target %q", e)
+		}
 	}
-	g := particle.NewGenerator(opts)
-	g.File(file)
-	return g.Generate(), nil
+	return backends, nil
 }
 
 // writeInto writes the given code into the output file or directory.
@@ -198,3 +350,18 @@ func (c *rootCmd) writeInto(srcPath, code string) error {
 
 	return nil
 }
+
+// writeSidecar writes a schema back-end's output, named name, next to the
+// generated Go code.
+func (c *rootCmd) writeSidecar(name string, data []byte) error {
+	dir := c.out
+	if strings.HasSuffix(dir, ".go") {
+		dir = filepath.Dir(dir)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
@@ -0,0 +1,86 @@
+package particle
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath is the file name particle looks for in the working
+// directory when no explicit config path is given.
+const DefaultConfigPath = "particle.yaml"
+
+// Config is the schema of a particle.yaml config file. It mirrors the CLI
+// flags and additionally lets per-type and per-field generation be tuned
+// without growing the command line.
+type Config struct {
+	// Patterns are the go/packages patterns to load, e.g. "./...".
+	Patterns []string `yaml:"patterns,omitempty"`
+
+	// Out is the output file or directory to write the generated code to.
+	Out string `yaml:"out,omitempty"`
+
+	// Package is the name of the package to generate the code in.
+	Package string `yaml:"package,omitempty"`
+
+	// StructTag is the name of the struct tag to use for indexing the
+	// partial map.
+	StructTag string `yaml:"structTag,omitempty"`
+
+	// TypePrefix is the prefix to use for the generated partial types.
+	TypePrefix string `yaml:"typePrefix,omitempty"`
+
+	// Plugins is the list of registered plugin names to run during
+	// generation.
+	Plugins []string `yaml:"plugins,omitempty"`
+
+	// Types holds per-type overrides, keyed by the source struct's name.
+	Types map[string]TypeConfig `yaml:"types,omitempty"`
+}
+
+// TypeConfig overrides generation for a single source struct.
+type TypeConfig struct {
+	// Prefix overrides TypePrefix for this type.
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Suffix is appended to the generated partial type's name.
+	Suffix string `yaml:"suffix,omitempty"`
+
+	// Disabled excludes the type from generation entirely.
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Fields holds per-field overrides, keyed by the source field's name.
+	Fields map[string]FieldConfig `yaml:"fields,omitempty"`
+}
+
+// FieldConfig overrides generation for a single field of a type.
+type FieldConfig struct {
+	// Key overrides the map key the field is stored and looked up under.
+	Key string `yaml:"key,omitempty"`
+
+	// Skip excludes the field from generation entirely.
+	Skip bool `yaml:"skip,omitempty"`
+
+	// Required marks the field as required in emitted schema definitions.
+	Required bool `yaml:"required,omitempty"`
+
+	// Type overrides the Go type emitted for the field's accessor and
+	// "With" function.
+	Type string `yaml:"type,omitempty"`
+}
+
+// LoadConfig reads and parses the particle.yaml config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse config: %w", err)
+	}
+
+	return &cfg, nil
+}
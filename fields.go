@@ -0,0 +1,88 @@
+package particle
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// TypeConfigFor returns the per-type overrides configured for the source
+// struct named name.
+func TypeConfigFor(opts GeneratorOpts, name string) TypeConfig {
+	return opts.Types[name]
+}
+
+// TypeName returns the name of the generated partial type for the source
+// struct named name, honoring any per-type prefix/suffix override.
+func TypeName(opts GeneratorOpts, name string) string {
+	tc := TypeConfigFor(opts, name)
+	prefix := opts.TypePrefix
+	if tc.Prefix != "" {
+		prefix = tc.Prefix
+	}
+	return prefix + name + tc.Suffix
+}
+
+// fieldName returns the identifier field is referenced by: its declared
+// name, or, for an anonymous/embedded field, the unqualified name of its
+// type, mirroring Go's own field-promotion rules.
+func fieldName(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+	return embeddedFieldName(field.Type)
+}
+
+// embeddedFieldName returns the unqualified identifier an anonymous field's
+// type is promoted under, e.g. "Mutex" for "sync.Mutex" or "Locker" for
+// "*sync.Locker".
+func embeddedFieldName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.StarExpr:
+		return embeddedFieldName(x.X)
+	case *ast.IndexExpr:
+		return embeddedFieldName(x.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(x.X)
+	default:
+		return ""
+	}
+}
+
+// FieldConfigFor returns the per-field overrides configured for field on the
+// source struct named typeName.
+func FieldConfigFor(opts GeneratorOpts, typeName string, field *ast.Field) FieldConfig {
+	return opts.Types[typeName].Fields[fieldName(field)]
+}
+
+// FieldKey returns the map key field is stored and looked up under: the
+// per-field key override if set, otherwise the value of the struct tag
+// named opts.StructTag, falling back to the field's Go name. SchemaBackends
+// use it to stay consistent with the Go generator's accessor and "With"
+// functions.
+func FieldKey(opts GeneratorOpts, typeName string, field *ast.Field) string {
+	key := fieldName(field)
+
+	if opts.StructTag != "" && field.Tag != nil {
+		if raw, err := strconv.Unquote(field.Tag.Value); err == nil {
+			tag := reflect.StructTag(raw).Get(opts.StructTag)
+			if tag != "" {
+				if i := strings.Index(tag, ","); i != -1 {
+					tag = tag[:i]
+				}
+				key = tag
+			}
+		}
+	}
+
+	if fc := FieldConfigFor(opts, typeName, field); fc.Key != "" {
+		key = fc.Key
+	}
+
+	return key
+}
@@ -1,12 +1,12 @@
 package particle
 
 import (
-	"errors"
 	"fmt"
-	"github.com/dave/jennifer/jen"
 	"go/ast"
-	"reflect"
-	"strings"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"golang.org/x/tools/go/packages"
 )
 
 type GeneratorOpts struct {
@@ -19,6 +19,14 @@ type GeneratorOpts struct {
 
 	// TypePrefix is the prefix to use for the generated partial types.
 	TypePrefix string `json:"typePrefix,omitempty"`
+
+	// Plugins is the list of registered plugin names to run after the
+	// built-in type, accessor, "With" functions, and ToStruct/FromStruct/
+	// ApplyTo converters have been generated.
+	Plugins []string `json:"plugins,omitempty"`
+
+	// Types holds per-type overrides, keyed by the source struct's name.
+	Types map[string]TypeConfig `json:"types,omitempty"`
 }
 
 type Generator struct {
@@ -27,15 +35,33 @@ type Generator struct {
 
 	// file is the jen.File to write the generated code to.
 	file *jen.File
+
+	// pkg is the type-checked package the generator draws type information
+	// from.
+	pkg *packages.Package
+
+	// plugins are the resolved plugins to run for every generated type.
+	plugins []Plugin
 }
 
-// NewGenerator creates a new generator configured by the given GeneratorOpts.
-func NewGenerator(opts GeneratorOpts) *Generator {
+// NewGenerator creates a new generator configured by the given GeneratorOpts,
+// resolving type information against pkg. It returns an error if any of
+// opts.Plugins does not match a plugin registered via RegisterPlugin.
+func NewGenerator(opts GeneratorOpts, pkg *packages.Package) (*Generator, error) {
 	trg := jen.NewFile(opts.Package)
 	trg.HeaderComment("Code generated by particle.")
 	trg.HeaderComment("https://github.com/lukasl-dev/particle")
 
-	return &Generator{opts: opts, file: trg}
+	ps, err := resolvePlugins(opts.Plugins)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve plugins: %w", err)
+	}
+
+	g := &Generator{opts: opts, file: trg, pkg: pkg, plugins: ps}
+	for _, p := range ps {
+		p.Init(g)
+	}
+	return g, nil
 }
 
 // Generate generates the code for the current file.
@@ -45,7 +71,6 @@ func (g *Generator) Generate() string {
 
 // File generates the code for the entire file.
 func (g *Generator) File(file *ast.File) {
-	g.Imports(file.Imports)
 	ast.Inspect(file, func(node ast.Node) bool {
 		switch node := node.(type) {
 		case *ast.TypeSpec:
@@ -53,32 +78,95 @@ func (g *Generator) File(file *ast.File) {
 			if !isStruct {
 				return true
 			}
+			if g.opts.Types[node.Name.Name].Disabled {
+				return true
+			}
+			if node.TypeParams != nil && len(node.TypeParams.List) > 0 {
+				// Generic structs are not supported yet: none of the
+				// generated signatures forward the source type's type
+				// parameters, so emitting them would reference an
+				// undeclared type parameter or an uninstantiated generic
+				// type. Skip rather than emit code that cannot compile.
+				return true
+			}
+			if hasAnonymousField(st) {
+				// Anonymous/embedded fields are not supported:
+				// Generator.fieldNames and AccessFunc read the field's
+				// name from ast.Field.Names, which an anonymous field
+				// leaves empty. Loading whole packages
+				// via go/packages (rather than hand-picked files) makes
+				// hitting one a near-certainty, so skip the type instead of
+				// panicking out of the entire run.
+				return true
+			}
 			g.Type(node)
 			for _, field := range st.Fields.List {
-				g.AccessFunc(node, field, file.Imports)
+				if g.fieldConfig(node.Name.Name, field).Skip {
+					continue
+				}
+				g.AccessFunc(node, field)
 				g.Line()
-				g.WithFunc(node, field, file.Imports)
+				g.WithFunc(node, field)
 				g.Line()
 			}
+			g.ToStructFunc(node, st.Fields.List)
+			g.Line()
+			g.FromStructFunc(node, st.Fields.List)
+			g.Line()
+			g.ApplyToFunc(node, st.Fields.List)
+			g.Line()
+			g.runPlugins(node, st.Fields.List)
 		}
 		return true
 	})
 }
 
-// Imports generates the code for the given import specs.
-func (g *Generator) Imports(imp []*ast.ImportSpec) {
-	for _, i := range imp {
-		g.Import(i)
+// runPlugins runs every configured plugin against typ and fields.
+func (g *Generator) runPlugins(typ *ast.TypeSpec, fields []*ast.Field) {
+	for _, p := range g.plugins {
+		p.GenerateType(typ, fields)
+		g.Line()
 	}
 }
 
-// Import generates the code for the given import spec.
-func (g *Generator) Import(imp *ast.ImportSpec) {
-	if imp.Name == nil {
-		g.file.ImportName(strings.Trim(imp.Path.Value, "\""), "")
-		return
-	}
-	g.file.ImportAlias(strings.Trim(imp.Path.Value, "\""), imp.Name.Name)
+// Opts returns the GeneratorOpts the generator was configured with. Plugins
+// use it to stay consistent with the core generator's naming and tagging
+// conventions.
+func (g *Generator) Opts() GeneratorOpts {
+	return g.opts
+}
+
+// TypeName returns the name of the generated partial type for the source
+// struct named name, honoring any per-type prefix/suffix override.
+func (g *Generator) TypeName(name string) string {
+	return TypeName(g.opts, name)
+}
+
+// FieldNames returns the name of the field and the respective key to use in
+// the map, as computed by the core generator. Plugins use it to stay
+// consistent with the accessor and "With" functions.
+func (g *Generator) FieldNames(typ *ast.TypeSpec, field *ast.Field) (fieldName, fieldKey string) {
+	return g.fieldNames(typ, field)
+}
+
+// FieldType returns the jen.Code used to declare or reference the type of
+// field, honoring any per-field type override and resolved against the
+// generator's package otherwise.
+func (g *Generator) FieldType(typ *ast.TypeSpec, field *ast.Field) jen.Code {
+	return g.fieldType(typ, field)
+}
+
+// FieldConfig returns the per-field overrides configured for field on the
+// source struct typ. Plugins use it to stay consistent with the core
+// generator's handling of skipped fields.
+func (g *Generator) FieldConfig(typ *ast.TypeSpec, field *ast.Field) FieldConfig {
+	return g.fieldConfig(typ.Name.Name, field)
+}
+
+// Add appends code to the generated file. Plugins use it to emit their own
+// declarations.
+func (g *Generator) Add(code ...jen.Code) {
+	g.file.Add(code...)
 }
 
 // Type generates a "partial" map-type.
@@ -88,21 +176,24 @@ func (g *Generator) Type(typ *ast.TypeSpec) {
 		panic("partial type must be a struct")
 	}
 
+	typeName := g.TypeName(typ.Name.Name)
+
 	g.file.Commentf(
-		"%s%s is a partial type.",
-		g.opts.TypePrefix,
-		typ.Name.Name,
+		"%s is a partial type.",
+		typeName,
 	)
-	g.file.Type().Id(g.opts.TypePrefix + typ.Name.Name).Map(jen.String()).Any()
+	g.file.Type().Id(typeName).Map(jen.String()).Any()
 }
 
 // AccessFunc generates the code for the function used to access a field.
-func (g *Generator) AccessFunc(typ *ast.TypeSpec, field *ast.Field, imp []*ast.ImportSpec) {
+func (g *Generator) AccessFunc(typ *ast.TypeSpec, field *ast.Field) {
 	if len(field.Names) == 0 {
 		panic("field must have a name")
 	}
 
-	fieldName, fieldKey := g.fieldNames(field)
+	typeName := g.TypeName(typ.Name.Name)
+	fieldName, fieldKey := g.fieldNames(typ, field)
+	fieldType := g.fieldType(typ, field)
 
 	g.file.Commentf(
 		"%s returns the value of the '%s' field.",
@@ -110,32 +201,34 @@ func (g *Generator) AccessFunc(typ *ast.TypeSpec, field *ast.Field, imp []*ast.I
 		fieldKey,
 	)
 	g.file.Func().
-		Params(jen.Id("p").Id(g.opts.TypePrefix + typ.Name.Name)).
+		Params(jen.Id("p").Id(typeName)).
 		Id(fieldName).
 		Params().
-		Add(g.determineType(field.Type, imp)).
+		Add(fieldType).
 		BlockFunc(func(bg *jen.Group) {
 			bg.Return(jen.Id("p").
 				Index(jen.Lit(fieldKey))).
-				Assert(g.determineType(field.Type, imp))
+				Assert(fieldType)
 		})
 }
 
 // WithFunc generates the code for the function used to update a field.
-func (g *Generator) WithFunc(typ *ast.TypeSpec, field *ast.Field, imp []*ast.ImportSpec) {
-	fieldName, fieldKey := g.fieldNames(field)
+func (g *Generator) WithFunc(typ *ast.TypeSpec, field *ast.Field) {
+	typeName := g.TypeName(typ.Name.Name)
+	fieldName, fieldKey := g.fieldNames(typ, field)
+	fieldType := g.fieldType(typ, field)
 
 	g.file.Commentf(
 		"With%s updates p with the given v and returns p again.",
 		fieldName,
 	)
 	g.file.Func().
-		Params(jen.Id("p").Id(g.opts.TypePrefix + typ.Name.Name)).
+		Params(jen.Id("p").Id(typeName)).
 		Id("With" + fieldName).
 		ParamsFunc(func(pg *jen.Group) {
-			pg.Id("v").Add(g.determineType(field.Type, imp))
+			pg.Id("v").Add(fieldType)
 		}).
-		Id(g.opts.TypePrefix + typ.Name.Name).
+		Id(typeName).
 		BlockFunc(func(fg *jen.Group) {
 			fg.Id("p").
 				Index(jen.Lit(fieldKey)).
@@ -145,78 +238,253 @@ func (g *Generator) WithFunc(typ *ast.TypeSpec, field *ast.Field, imp []*ast.Imp
 		})
 }
 
+// ToStructFunc generates the code for the function that converts p into the
+// source struct, using base as the value for any field p does not contain.
+func (g *Generator) ToStructFunc(typ *ast.TypeSpec, fields []*ast.Field) {
+	typeName := g.TypeName(typ.Name.Name)
+	sourceType := g.sourceType(typ)
+
+	g.file.Commentf(
+		"ToStruct returns base with every field present in p overwritten by p's value.",
+	)
+	g.file.Func().
+		Params(jen.Id("p").Id(typeName)).
+		Id("ToStruct").
+		Params(jen.Id("base").Add(sourceType)).
+		Add(sourceType).
+		BlockFunc(func(bg *jen.Group) {
+			for _, field := range fields {
+				if g.fieldConfig(typ.Name.Name, field).Skip {
+					continue
+				}
+				fieldName, fieldKey := g.fieldNames(typ, field)
+				bg.If(
+					jen.List(jen.Id("v"), jen.Id("ok")).Op(":=").Id("p").Index(jen.Lit(fieldKey)),
+					jen.Id("ok"),
+				).Block(
+					jen.Id("base").Dot(fieldName).Op("=").Id("v").Assert(g.fieldType(typ, field)),
+				)
+			}
+			bg.Return(jen.Id("base"))
+		})
+}
+
+// FromStructFunc generates the code for the function that populates a
+// partial type from every field of the source struct.
+func (g *Generator) FromStructFunc(typ *ast.TypeSpec, fields []*ast.Field) {
+	typeName := g.TypeName(typ.Name.Name)
+	sourceType := g.sourceType(typ)
+
+	g.file.Commentf(
+		"From%s returns a %s populated from every field of v.",
+		typ.Name.Name,
+		typeName,
+	)
+	g.file.Func().
+		Id("From"+typ.Name.Name).
+		Params(jen.Id("v").Add(sourceType)).
+		Id(typeName).
+		BlockFunc(func(bg *jen.Group) {
+			bg.Id("p").Op(":=").Make(jen.Id(typeName), jen.Lit(len(fields)))
+			for _, field := range fields {
+				if g.fieldConfig(typ.Name.Name, field).Skip {
+					continue
+				}
+				fieldName, fieldKey := g.fieldNames(typ, field)
+				bg.Id("p").Index(jen.Lit(fieldKey)).Op("=").Id("v").Dot(fieldName)
+			}
+			bg.Return(jen.Id("p"))
+		})
+}
+
+// ApplyToFunc generates the code for the function that applies p onto v in
+// place, implementing a JSON-Merge-Patch style update.
+func (g *Generator) ApplyToFunc(typ *ast.TypeSpec, fields []*ast.Field) {
+	typeName := g.TypeName(typ.Name.Name)
+	sourceType := g.sourceType(typ)
+
+	g.file.Commentf(
+		"ApplyTo overwrites every field of v present in p with p's value.",
+	)
+	g.file.Func().
+		Params(jen.Id("p").Id(typeName)).
+		Id("ApplyTo").
+		Params(jen.Id("v").Op("*").Add(sourceType)).
+		BlockFunc(func(bg *jen.Group) {
+			for _, field := range fields {
+				if g.fieldConfig(typ.Name.Name, field).Skip {
+					continue
+				}
+				fieldName, fieldKey := g.fieldNames(typ, field)
+				bg.If(
+					jen.List(jen.Id("x"), jen.Id("ok")).Op(":=").Id("p").Index(jen.Lit(fieldKey)),
+					jen.Id("ok"),
+				).Block(
+					jen.Id("v").Dot(fieldName).Op("=").Id("x").Assert(g.fieldType(typ, field)),
+				)
+			}
+		})
+}
+
 // Line inserts an empty line into the generated code.
 func (g *Generator) Line() {
 	g.file.Line()
 }
 
 // fieldNames returns the name of the field and the respective key to use in
-// the map. The key is either the field name or the value of the struct tag
-// with the name specified in the generator options.
-func (g *Generator) fieldNames(field *ast.Field) (fieldName, fieldKey string) {
-	if g.opts.StructTag != "" && field.Tag != nil {
-		tag := reflect.StructTag(field.Tag.Value).Get(g.opts.StructTag)
-		if tag != "" {
-			i := strings.Index(tag, ",")
-			if i != -1 {
-				tag = tag[:i]
-			}
-			return field.Names[0].Name, tag
-		}
+// the map, as determined by FieldKey.
+func (g *Generator) fieldNames(typ *ast.TypeSpec, field *ast.Field) (fieldName, fieldKey string) {
+	return field.Names[0].Name, FieldKey(g.opts, typ.Name.Name, field)
+}
+
+// fieldConfig returns the per-field overrides configured for field on the
+// source struct named typeName.
+func (g *Generator) fieldConfig(typeName string, field *ast.Field) FieldConfig {
+	return FieldConfigFor(g.opts, typeName, field)
+}
+
+// fieldType returns the jen.Code used to declare or reference the type of
+// field, honoring a per-field type override.
+func (g *Generator) fieldType(typ *ast.TypeSpec, field *ast.Field) jen.Code {
+	if fc := g.fieldConfig(typ.Name.Name, field); fc.Type != "" {
+		return jen.Op(fc.Type)
 	}
-	return field.Names[0].Name, field.Names[0].Name
+	return g.determineType(g.typeOf(field.Type))
 }
 
-func (g *Generator) determineType(typ ast.Expr, imp []*ast.ImportSpec) jen.Code {
-	switch x := typ.(type) {
-	case *ast.Ident:
-		return jen.Id(x.Name)
+// typeOf resolves the type.Type of expr using the type-checker results of
+// the generator's package.
+func (g *Generator) typeOf(expr ast.Expr) types.Type {
+	t := g.pkg.TypesInfo.TypeOf(expr)
+	if t == nil {
+		panic(fmt.Sprintf("no type information for %T", expr))
+	}
+	return t
+}
 
-	case *ast.SelectorExpr:
-		fieldTypeName, fieldTypePkg, err := g.qualify(x, imp)
-		if err != nil {
-			panic("could not qualify type: " + err.Error())
+// determineType converts t into the jen.Code used to declare or reference
+// it in the generated file, qualifying named types with their defining
+// import path as qualify does (types of the generator's own package are left
+// unqualified).
+func (g *Generator) determineType(t types.Type) jen.Code {
+	switch x := t.(type) {
+	case *types.Basic:
+		return jen.Id(x.Name())
+
+	case *types.Named:
+		return g.qualify(x)
+
+	case *types.TypeParam:
+		return jen.Id(x.Obj().Name())
+
+	case *types.Pointer:
+		return jen.Op("*").Add(g.determineType(x.Elem()))
+
+	case *types.Slice:
+		return jen.Index().Add(g.determineType(x.Elem()))
+
+	case *types.Array:
+		return jen.Index(jen.Lit(int(x.Len()))).Add(g.determineType(x.Elem()))
+
+	case *types.Map:
+		return jen.Map(g.determineType(x.Key())).Add(g.determineType(x.Elem()))
+
+	case *types.Chan:
+		switch x.Dir() {
+		case types.SendOnly:
+			return jen.Op("chan<-").Add(g.determineType(x.Elem()))
+		case types.RecvOnly:
+			return jen.Op("<-chan").Add(g.determineType(x.Elem()))
+		default:
+			return jen.Chan().Add(g.determineType(x.Elem()))
 		}
-		return jen.Qual(fieldTypePkg, fieldTypeName)
-
-	case *ast.MapType:
-		key := g.determineType(x.Key, imp)
-		value := g.determineType(x.Value, imp)
-		return jen.Map(key).Add(value)
 
-	case *ast.ArrayType:
-		return jen.Index().Add(g.determineType(x.Elt, imp))
+	case *types.Interface:
+		if x.NumMethods() == 0 {
+			return jen.Any()
+		}
+		return jen.Interface()
 
-	case *ast.StarExpr:
-		return jen.Op("*").Add(g.determineType(x.X, imp))
+	case *types.Signature:
+		return g.determineSignature(x)
 
 	default:
 		panic(fmt.Sprintf("unsupported type %T", x))
 	}
 }
 
-// qualify resolves the type of the given expression and returns the name of
-// the type and the package it is defined in.
+// determineSignature converts a func type's signature into jen.Code.
+func (g *Generator) determineSignature(sig *types.Signature) jen.Code {
+	c := jen.Func()
+	c = c.ParamsFunc(func(pg *jen.Group) {
+		params := sig.Params()
+		for i := 0; i < params.Len(); i++ {
+			pg.Add(g.determineType(params.At(i).Type()))
+		}
+	})
+
+	results := sig.Results()
+	switch results.Len() {
+	case 0:
+		return c
+	case 1:
+		return c.Add(g.determineType(results.At(0).Type()))
+	default:
+		return c.ParamsFunc(func(pg *jen.Group) {
+			for i := 0; i < results.Len(); i++ {
+				pg.Add(g.determineType(results.At(i).Type()))
+			}
+		})
+	}
+}
+
+// qualify converts a named type into jen.Code, qualifying it with its
+// defining import path unless it belongs to the package currently being
+// generated for.
 //
-// Example: Given the import "github.com/lukasl-dev/particle" and the type
-// "particle.Generator", the function returns "Generator" and
-// "github.com/lukasl-dev/particle".
-func (g *Generator) qualify(
-	expr *ast.SelectorExpr,
-	imports []*ast.ImportSpec,
-) (name, pkg string, err error) {
-	pkgName := expr.X.(*ast.Ident).Name
-
-	for _, imp := range imports {
-		path := strings.Trim(imp.Path.Value, "\"")
-
-		split := strings.Split(path, "/")
-		last := split[len(split)-1]
-
-		if last == pkgName || (imp.Name != nil && imp.Name.Name == pkgName) {
-			return expr.Sel.Name, path, nil
+// Example: Given the named type "particle.Generator" defined in
+// "github.com/lukasl-dev/particle", qualify emits a reference qualified
+// with that import path.
+func (g *Generator) qualify(named *types.Named) jen.Code {
+	obj := named.Obj()
+
+	var c *jen.Statement
+	if pkg := obj.Pkg(); pkg != nil && pkg.Path() != g.pkg.PkgPath {
+		c = jen.Qual(pkg.Path(), obj.Name())
+	} else {
+		c = jen.Id(obj.Name())
+	}
+
+	if targs := named.TypeArgs(); targs != nil && targs.Len() > 0 {
+		args := make([]jen.Code, targs.Len())
+		for i := 0; i < targs.Len(); i++ {
+			args[i] = g.determineType(targs.At(i))
 		}
+		c = c.Index(args...)
 	}
 
-	return "", "", errors.New("could not find import")
+	return c
+}
+
+// sourceType returns the jen.Code referencing the source struct typ,
+// always qualified with its defining import path. Unlike qualify, which
+// omits the qualifier for types local to the package being generated for,
+// the source struct itself is never local to that package: the converter
+// functions live in the generated output package, not the source package,
+// and the partial type's own name may equal typ.Name.Name when no
+// TypePrefix/Suffix is configured. An unqualified reference would then
+// resolve to the partial map type instead of the source struct.
+func (g *Generator) sourceType(typ *ast.TypeSpec) jen.Code {
+	return jen.Qual(g.pkg.PkgPath, typ.Name.Name)
+}
+
+// hasAnonymousField reports whether st declares any anonymous/embedded
+// field, i.e. a field with no ast.Field.Names entry.
+func hasAnonymousField(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,49 @@
+package particle
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// Plugin generates additional code for a partial type after the generator
+// has emitted its map type, accessor, "With" functions, and the built-in
+// ToStruct/FromStruct/ApplyTo converters. Plugins are modeled after
+// protoc-gen-go's RegisterPlugin hook: a plugin registers itself once via
+// RegisterPlugin and is then opted into generation by name, either via the
+// CLI's "--plugin" flag or the config file.
+type Plugin interface {
+	// Name returns the unique name the plugin is selected by.
+	Name() string
+
+	// Init is called once before generation starts, giving the plugin a
+	// handle to the Generator it runs alongside.
+	Init(g *Generator)
+
+	// GenerateType generates additional code for the partial type derived
+	// from typ, using fields to enumerate the source struct's fields.
+	GenerateType(typ *ast.TypeSpec, fields []*ast.Field)
+}
+
+// plugins holds every plugin registered via RegisterPlugin, keyed by name.
+var plugins = map[string]Plugin{}
+
+// RegisterPlugin registers p under p.Name(), making it selectable from
+// GeneratorOpts.Plugins. RegisterPlugin is typically called from a plugin
+// package's init function.
+func RegisterPlugin(p Plugin) {
+	plugins[p.Name()] = p
+}
+
+// resolvePlugins looks up the plugins registered under names, in order. It
+// returns an error if a name does not match a registered plugin.
+func resolvePlugins(names []string) ([]Plugin, error) {
+	ps := make([]Plugin, 0, len(names))
+	for _, name := range names {
+		p, ok := plugins[name]
+		if !ok {
+			return nil, fmt.Errorf("no plugin registered with name %q", name)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
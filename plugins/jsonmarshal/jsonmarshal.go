@@ -0,0 +1,132 @@
+// Package jsonmarshal is a particle.Plugin that generates MarshalJSON and
+// UnmarshalJSON methods for a partial type, respecting the source struct's
+// "json" tags.
+package jsonmarshal
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"github.com/lukasl-dev/particle"
+)
+
+func init() {
+	particle.RegisterPlugin(New())
+}
+
+// Plugin generates MarshalJSON and UnmarshalJSON methods.
+type Plugin struct {
+	g *particle.Generator
+}
+
+// New creates a new Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// Name returns "json".
+func (p *Plugin) Name() string {
+	return "json"
+}
+
+// Init stores g for later use by GenerateType.
+func (p *Plugin) Init(g *particle.Generator) {
+	p.g = g
+}
+
+// GenerateType generates MarshalJSON and UnmarshalJSON for the partial type
+// derived from typ.
+func (p *Plugin) GenerateType(typ *ast.TypeSpec, fields []*ast.Field) {
+	typeName := p.g.TypeName(typ.Name.Name)
+
+	p.g.Add(jen.Commentf(
+		"MarshalJSON marshals p into its JSON representation, using the "+
+			"source struct's json tags as keys where present.",
+	))
+	p.g.Add(jen.Func().
+		Params(jen.Id("p").Id(typeName)).
+		Id("MarshalJSON").
+		Params().
+		Params(jen.Index().Byte(), jen.Error()).
+		BlockFunc(func(bg *jen.Group) {
+			bg.Id("m").Op(":=").Make(jen.Map(jen.String()).Any(), jen.Len(jen.Id("p")))
+			for _, field := range fields {
+				if p.g.FieldConfig(typ, field).Skip {
+					continue
+				}
+				_, fieldKey := p.g.FieldNames(typ, field)
+				jsonKey := p.jsonKey(field, fieldKey)
+				if jsonKey == "-" {
+					continue
+				}
+				bg.If(
+					jen.List(jen.Id("v"), jen.Id("ok")).Op(":=").Id("p").Index(jen.Lit(fieldKey)),
+					jen.Id("ok"),
+				).Block(
+					jen.Id("m").Index(jen.Lit(jsonKey)).Op("=").Id("v"),
+				)
+			}
+			bg.Return(jen.Qual("encoding/json", "Marshal").Call(jen.Id("m")))
+		}))
+	p.g.Line()
+
+	p.g.Add(jen.Commentf("UnmarshalJSON unmarshals data into p."))
+	p.g.Add(jen.Func().
+		Params(jen.Id("p").Op("*").Id(typeName)).
+		Id("UnmarshalJSON").
+		Params(jen.Id("data").Index().Byte()).
+		Params(jen.Error()).
+		BlockFunc(func(bg *jen.Group) {
+			bg.Var().Id("m").Map(jen.String()).Any()
+			bg.If(
+				jen.Err().Op(":=").Qual("encoding/json", "Unmarshal").Call(jen.Id("data"), jen.Op("&").Id("m")),
+				jen.Err().Op("!=").Nil(),
+			).Block(
+				jen.Return(jen.Err()),
+			)
+			bg.Op("*").Id("p").Op("=").Make(jen.Id(typeName), jen.Len(jen.Id("m")))
+			for _, field := range fields {
+				if p.g.FieldConfig(typ, field).Skip {
+					continue
+				}
+				_, fieldKey := p.g.FieldNames(typ, field)
+				jsonKey := p.jsonKey(field, fieldKey)
+				if jsonKey == "-" {
+					continue
+				}
+				bg.If(
+					jen.List(jen.Id("v"), jen.Id("ok")).Op(":=").Id("m").Index(jen.Lit(jsonKey)),
+					jen.Id("ok"),
+				).Block(
+					jen.Parens(jen.Op("*").Id("p")).Index(jen.Lit(fieldKey)).Op("=").Id("v"),
+				)
+			}
+			bg.Return(jen.Nil())
+		}))
+}
+
+// jsonKey returns the key field is marshaled under, derived from its "json"
+// tag. It falls back to fallback if the field has no "json" tag.
+func (p *Plugin) jsonKey(field *ast.Field, fallback string) string {
+	if field.Tag == nil {
+		return fallback
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return fallback
+	}
+	tag := reflect.StructTag(raw).Get("json")
+	if tag == "" {
+		return fallback
+	}
+	if i := strings.Index(tag, ","); i != -1 {
+		tag = tag[:i]
+	}
+	if tag == "" {
+		return fallback
+	}
+	return tag
+}
@@ -0,0 +1,53 @@
+package particle
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// SchemaBackend emits schema definitions describing the partial types
+// declared in a package, using a format of its own choosing (CUE, JSON
+// Schema, ...).
+type SchemaBackend interface {
+	// Name returns the unique name the backend is selected by, e.g. via the
+	// CLI's "--emit" flag.
+	Name() string
+
+	// Extension returns the file extension, including the leading dot, used
+	// for files this backend produces, e.g. ".cue".
+	Extension() string
+
+	// Emit generates the schema definitions for every struct declared in
+	// pkg, resolving field types against info the same way the Go
+	// generator resolves them via types.Info.TypeOf.
+	Emit(pkg *ast.Package, info *types.Info) ([]byte, error)
+}
+
+// SchemaGenerator runs a set of SchemaBackends against a package, producing
+// one side-car file per backend.
+type SchemaGenerator struct {
+	opts     GeneratorOpts
+	backends []SchemaBackend
+}
+
+// NewSchemaGenerator creates a new SchemaGenerator configured by opts,
+// running every given backend.
+func NewSchemaGenerator(opts GeneratorOpts, backends ...SchemaBackend) *SchemaGenerator {
+	return &SchemaGenerator{opts: opts, backends: backends}
+}
+
+// Emit runs every configured backend against pkg and returns the generated
+// files, keyed by the file name they should be written to, e.g.
+// "foo.schema.json" for baseName "foo".
+func (s *SchemaGenerator) Emit(pkg *ast.Package, info *types.Info, baseName string) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(s.backends))
+	for _, b := range s.backends {
+		data, err := b.Emit(pkg, info)
+		if err != nil {
+			return nil, fmt.Errorf("could not emit %s schema: %w", b.Name(), err)
+		}
+		out[baseName+b.Extension()] = data
+	}
+	return out, nil
+}
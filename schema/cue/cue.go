@@ -0,0 +1,193 @@
+// Package cue implements a particle.SchemaBackend that emits CUE
+// definitions for partial types, modeled after the output of "cue get go".
+package cue
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"github.com/lukasl-dev/particle"
+)
+
+// Backend emits one CUE definition per partial type, e.g.:
+//
+//	#PartialFoo: {
+//		name?: string
+//		age?: int
+//	}
+type Backend struct {
+	opts particle.GeneratorOpts
+
+	// pkg is the types.Package of the package currently being emitted,
+	// used to tell a local struct reference apart from a same-named type
+	// defined in another package (e.g. time.Time, or a different module's
+	// own "models" package), set for the duration of Emit.
+	pkg *types.Package
+}
+
+// New creates a new Backend configured by opts.
+func New(opts particle.GeneratorOpts) *Backend {
+	return &Backend{opts: opts}
+}
+
+// Name returns "cue".
+func (b *Backend) Name() string {
+	return "cue"
+}
+
+// Extension returns ".cue".
+func (b *Backend) Extension() string {
+	return ".cue"
+}
+
+// Emit generates the CUE definitions for every struct declared in pkg,
+// resolving field types against info.
+func (b *Backend) Emit(pkg *ast.Package, info *types.Info) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, decl := range particle.Structs(pkg) {
+		if obj := info.Defs[decl.Spec.Name]; obj != nil {
+			b.pkg = obj.Pkg()
+		}
+		typeName := decl.Spec.Name.Name
+		if particle.TypeConfigFor(b.opts, typeName).Disabled {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "#%s: {\n", b.definitionName(typeName))
+		for _, field := range decl.Type.Fields.List {
+			fc := particle.FieldConfigFor(b.opts, typeName, field)
+			if fc.Skip {
+				continue
+			}
+
+			key := particle.FieldKey(b.opts, typeName, field)
+			typ, err := b.typeOf(info, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("could not emit field %q of %q: %w", key, typeName, err)
+			}
+
+			optional := "?"
+			if fc.Required {
+				optional = ""
+			}
+			fmt.Fprintf(&buf, "\t%s%s: %s\n", key, optional, typ)
+		}
+		buf.WriteString("}\n\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// definitionName returns the CUE definition name for the source struct
+// named typeName.
+func (b *Backend) definitionName(typeName string) string {
+	return particle.TypeName(b.opts, typeName)
+}
+
+// typeOf resolves the type.Type of expr via info, the same way the Go
+// generator resolves field types, and returns the CUE type used to
+// describe it.
+func (b *Backend) typeOf(info *types.Info, expr ast.Expr) (string, error) {
+	t := info.TypeOf(expr)
+	if t == nil {
+		return "", fmt.Errorf("no type information for %T", expr)
+	}
+	return b.cueType(t)
+}
+
+// cueType converts t into the CUE type used to describe it.
+func (b *Backend) cueType(t types.Type) (string, error) {
+	switch x := t.(type) {
+	case *types.Basic:
+		return b.scalar(x), nil
+
+	case *types.Named:
+		return b.named(x)
+
+	case *types.Pointer:
+		elem, err := b.cueType(x.Elem())
+		if err != nil {
+			return "", err
+		}
+		return elem + " | null", nil
+
+	case *types.Slice:
+		elem, err := b.cueType(x.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "[..." + elem + "]", nil
+
+	case *types.Array:
+		elem, err := b.cueType(x.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "[..." + elem + "]", nil
+
+	case *types.Map:
+		value, err := b.cueType(x.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "{[string]: " + value + "}", nil
+
+	default:
+		// Interfaces, type parameters and anything else we don't have a
+		// precise CUE mapping for are represented as CUE's top type rather
+		// than aborting the whole schema.
+		return "_", nil
+	}
+}
+
+// named converts a named type into its CUE representation: a reference to
+// another generated definition for a struct declared in the package being
+// emitted, the CUE type of its underlying basic type for a named scalar
+// (e.g. "type Celsius float64"), or CUE's top type for anything else (e.g.
+// a struct defined in another package, such as time.Time, that particle
+// isn't generating a definition for).
+func (b *Backend) named(named *types.Named) (string, error) {
+	switch u := named.Underlying().(type) {
+	case *types.Basic:
+		return b.scalar(u), nil
+
+	case *types.Struct:
+		if b.definesLocally(named.Obj()) {
+			return "#" + particle.TypeName(b.opts, named.Obj().Name()), nil
+		}
+		return "_", nil
+
+	default:
+		return "_", nil
+	}
+}
+
+// definesLocally reports whether this backend will emit a definition for
+// obj: obj must be declared in the package currently being emitted
+// (compared by import path, not package name, since two different
+// packages can share a name) and must not be disabled via Types[...].
+func (b *Backend) definesLocally(obj *types.TypeName) bool {
+	if obj.Pkg() == nil || b.pkg == nil || obj.Pkg().Path() != b.pkg.Path() {
+		return false
+	}
+	return !particle.TypeConfigFor(b.opts, obj.Name()).Disabled
+}
+
+// scalar maps a Go basic kind to its CUE scalar.
+func (b *Backend) scalar(t *types.Basic) string {
+	switch {
+	case t.Info()&types.IsBoolean != 0:
+		return "bool"
+	case t.Info()&types.IsString != 0:
+		return "string"
+	case t.Info()&types.IsInteger != 0:
+		return "int"
+	case t.Info()&types.IsFloat != 0:
+		return "float"
+	default:
+		return "_"
+	}
+}
@@ -0,0 +1,202 @@
+// Package jsonschema implements a particle.SchemaBackend that emits JSON
+// Schema (draft 2020-12) definitions for partial types.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"github.com/lukasl-dev/particle"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Backend emits one JSON Schema "$defs" entry per partial type.
+type Backend struct {
+	opts particle.GeneratorOpts
+
+	// pkg is the types.Package of the package currently being emitted,
+	// used to tell a local struct reference apart from a same-named type
+	// defined in another package (e.g. time.Time, or a different module's
+	// own "models" package), set for the duration of Emit.
+	pkg *types.Package
+}
+
+// New creates a new Backend configured by opts.
+func New(opts particle.GeneratorOpts) *Backend {
+	return &Backend{opts: opts}
+}
+
+// Name returns "jsonschema".
+func (b *Backend) Name() string {
+	return "jsonschema"
+}
+
+// Extension returns ".schema.json".
+func (b *Backend) Extension() string {
+	return ".schema.json"
+}
+
+// schema is the subset of JSON Schema draft 2020-12 particle emits.
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Defs                 map[string]*schema `json:"$defs,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AnyOf                []*schema          `json:"anyOf,omitempty"`
+}
+
+// Emit generates the JSON Schema definitions for every struct declared in
+// pkg, resolving field types against info.
+func (b *Backend) Emit(pkg *ast.Package, info *types.Info) ([]byte, error) {
+	root := &schema{Schema: draft, Defs: map[string]*schema{}}
+
+	for _, decl := range particle.Structs(pkg) {
+		if obj := info.Defs[decl.Spec.Name]; obj != nil {
+			b.pkg = obj.Pkg()
+		}
+		typeName := decl.Spec.Name.Name
+		if particle.TypeConfigFor(b.opts, typeName).Disabled {
+			continue
+		}
+
+		def := &schema{
+			Type:                 "object",
+			Properties:           map[string]*schema{},
+			AdditionalProperties: false,
+		}
+
+		for _, field := range decl.Type.Fields.List {
+			fc := particle.FieldConfigFor(b.opts, typeName, field)
+			if fc.Skip {
+				continue
+			}
+
+			key := particle.FieldKey(b.opts, typeName, field)
+			fs, err := b.schemaOf(info, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("could not emit field %q of %q: %w", key, typeName, err)
+			}
+			def.Properties[key] = fs
+
+			if fc.Required {
+				def.Required = append(def.Required, key)
+			}
+		}
+
+		root.Defs[particle.TypeName(b.opts, typeName)] = def
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaOf resolves the type.Type of expr via info, the same way the Go
+// generator resolves field types, and returns the JSON Schema used to
+// describe it.
+func (b *Backend) schemaOf(info *types.Info, expr ast.Expr) (*schema, error) {
+	t := info.TypeOf(expr)
+	if t == nil {
+		return nil, fmt.Errorf("no type information for %T", expr)
+	}
+	return b.jsonSchema(t)
+}
+
+// jsonSchema converts t into the JSON Schema used to describe it.
+func (b *Backend) jsonSchema(t types.Type) (*schema, error) {
+	switch x := t.(type) {
+	case *types.Basic:
+		return b.scalar(x), nil
+
+	case *types.Named:
+		return b.named(x)
+
+	case *types.Pointer:
+		elem, err := b.jsonSchema(x.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schema{AnyOf: []*schema{elem, {Type: "null"}}}, nil
+
+	case *types.Slice:
+		items, err := b.jsonSchema(x.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schema{Type: "array", Items: items}, nil
+
+	case *types.Array:
+		items, err := b.jsonSchema(x.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schema{Type: "array", Items: items}, nil
+
+	case *types.Map:
+		values, err := b.jsonSchema(x.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schema{Type: "object", AdditionalProperties: values}, nil
+
+	default:
+		// Interfaces, type parameters and anything else we don't have a
+		// precise JSON Schema mapping for are left as the empty schema
+		// (matches any value) rather than aborting the whole schema.
+		return &schema{}, nil
+	}
+}
+
+// named converts a named type into its JSON Schema representation: a $ref
+// to another generated definition for a struct declared in the package
+// being emitted, the schema of its underlying basic type for a named
+// scalar (e.g. "type Celsius float64"), or the empty schema for anything
+// else (e.g. a struct defined in another package, such as time.Time, that
+// particle isn't generating a definition for).
+func (b *Backend) named(named *types.Named) (*schema, error) {
+	switch u := named.Underlying().(type) {
+	case *types.Basic:
+		return b.scalar(u), nil
+
+	case *types.Struct:
+		if b.definesLocally(named.Obj()) {
+			return &schema{Ref: "#/$defs/" + particle.TypeName(b.opts, named.Obj().Name())}, nil
+		}
+		return &schema{}, nil
+
+	default:
+		return &schema{}, nil
+	}
+}
+
+// definesLocally reports whether this backend will emit a definition for
+// obj: obj must be declared in the package currently being emitted
+// (compared by import path, not package name, since two different
+// packages can share a name) and must not be disabled via Types[...].
+func (b *Backend) definesLocally(obj *types.TypeName) bool {
+	if obj.Pkg() == nil || b.pkg == nil || obj.Pkg().Path() != b.pkg.Path() {
+		return false
+	}
+	return !particle.TypeConfigFor(b.opts, obj.Name()).Disabled
+}
+
+// scalar maps a Go basic kind to its JSON type.
+func (b *Backend) scalar(t *types.Basic) *schema {
+	switch {
+	case t.Info()&types.IsBoolean != 0:
+		return &schema{Type: "boolean"}
+	case t.Info()&types.IsString != 0:
+		return &schema{Type: "string"}
+	case t.Info()&types.IsInteger != 0:
+		return &schema{Type: "integer"}
+	case t.Info()&types.IsFloat != 0:
+		return &schema{Type: "number"}
+	default:
+		return &schema{}
+	}
+}